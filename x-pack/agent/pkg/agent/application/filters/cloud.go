@@ -0,0 +1,150 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package filters
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Values for host.cloud.
+const (
+	cloudAWS   = "aws"
+	cloudGCP   = "gcp"
+	cloudAzure = "azure"
+	cloudNone  = "none"
+)
+
+// cloudEnvHint lets an operator (or a provisioning script) declare the cloud
+// provider directly, skipping the IMDS probes below entirely.
+const cloudEnvHint = "ELASTIC_AGENT_CLOUD_PROVIDER"
+
+// imdsTimeout is kept short: on non-cloud hosts these addresses are
+// unreachable and every startup would otherwise stall waiting on them. It
+// applies per request; the three providers are probed concurrently, and the
+// AWS probe makes two requests in sequence (token, then metadata), so
+// detectCloud blocks for at most about twice this.
+const imdsTimeout = 250 * time.Millisecond
+
+const (
+	awsTokenURL      = "http://169.254.169.254/latest/api/token"
+	awsMetadataURL   = "http://169.254.169.254/latest/meta-data/"
+	gcpMetadataURL   = "http://169.254.169.254/computeMetadata/v1/"
+	azureMetadataURL = "http://169.254.169.254/metadata/instance?api-version=2021-02-01"
+)
+
+// detectCloud identifies the cloud provider the host is running on, if any,
+// via an environment hint or a probe of each provider's instance metadata
+// service (IMDS). The probes run concurrently so a non-cloud host only
+// blocks startup for the slowest probe (the two-request AWS one), not the
+// sum of all three.
+func detectCloud() string {
+	if hint := os.Getenv(cloudEnvHint); hint != "" {
+		return hint
+	}
+
+	client := &http.Client{Timeout: imdsTimeout}
+
+	probes := []struct {
+		provider string
+		probe    func(*http.Client) bool
+	}{
+		{cloudAWS, probeAWS},
+		{cloudGCP, probeGCP},
+		{cloudAzure, probeAzure},
+	}
+
+	found := make(chan string, len(probes))
+	var wg sync.WaitGroup
+	for _, p := range probes {
+		wg.Add(1)
+		go func(provider string, probe func(*http.Client) bool) {
+			defer wg.Done()
+			if probe(client) {
+				found <- provider
+			}
+		}(p.provider, p.probe)
+	}
+
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	for provider := range found {
+		return provider
+	}
+
+	return cloudNone
+}
+
+// probeAWS follows the IMDSv2 handshake (fetch a session token, then send it
+// on the metadata request) since IMDSv2-enforced instances - the hardened
+// default - return 401 to a bare GET. It falls back to an unauthenticated
+// IMDSv1-style GET if the token request fails, for older configurations.
+func probeAWS(client *http.Client) bool {
+	headers := map[string]string{}
+	if token := fetchAWSToken(client); token != "" {
+		headers["X-aws-ec2-metadata-token"] = token
+	}
+
+	return probeIMDS(client, awsMetadataURL, headers)
+}
+
+func fetchAWSToken(client *http.Client) string {
+	req, err := http.NewRequest(http.MethodPut, awsTokenURL, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	token, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(token))
+}
+
+func probeGCP(client *http.Client) bool {
+	return probeIMDS(client, gcpMetadataURL, map[string]string{"Metadata-Flavor": "Google"})
+}
+
+func probeAzure(client *http.Client) bool {
+	return probeIMDS(client, azureMetadataURL, map[string]string{"Metadata": "true"})
+}
+
+func probeIMDS(client *http.Client, url string, headers map[string]string) bool {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode == http.StatusOK
+}
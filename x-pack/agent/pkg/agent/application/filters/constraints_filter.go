@@ -6,33 +6,43 @@ package filters
 
 import (
 	"fmt"
-	"runtime"
 
 	"github.com/Masterminds/semver"
 
-	"github.com/elastic/beats/v7/x-pack/agent/pkg/agent/application/info"
 	"github.com/elastic/beats/v7/x-pack/agent/pkg/agent/errors"
 	"github.com/elastic/beats/v7/x-pack/agent/pkg/agent/transpiler"
 	"github.com/elastic/beats/v7/x-pack/agent/pkg/boolexp"
 	"github.com/elastic/beats/v7/x-pack/agent/pkg/core/logger"
-	"github.com/elastic/beats/v7/x-pack/agent/pkg/release"
-	"github.com/elastic/go-sysinfo"
 )
 
 const (
-	datasourcesKey          = "datasources"
-	constraintsKey          = "constraints"
+	datasourcesKey = "datasources"
+	inputsKey      = "inputs"
+	outputsKey     = "outputs"
+
+	// constraintsKey is an AND-all-of list: every expression must match.
+	constraintsKey = "constraints"
+	// constraintsAnyKey is an OR-any-of list: at least one expression must match.
+	constraintsAnyKey = "constraints_any"
+
 	validateVersionFuncName = "validate_version"
 )
 
+// constraintFilterKeys lists the AST nodes ConstraintFilter prunes.
+var constraintFilterKeys = []string{datasourcesKey, inputsKey, outputsKey}
+
 // List of variables available to be used in constraint definitions.
 const (
 	// `agent.id` is a generated (in standalone) or assigned (in fleet) agent identifier.
 	agentIDKey = "agent.id"
 	// `agent.version` specifies current version of an agent.
 	agentVersionKey = "agent.version"
+	// `agent.tags` lists the fleet-assigned tags for this agent.
+	agentTagsKey = "agent.tags"
 	// `host.architecture` defines architecture of a host (e.g. x86_64, arm, ppc, mips).
 	hostArchKey = "host.architecture"
+	// `host.name` is the host's hostname.
+	hostNameKey = "host.name"
 	// `os.family` defines a family of underlying operating system (e.g. redhat, debian, freebsd, windows).
 	osFamilyKey = "os.family"
 	// `os.kernel` specifies current version of a kernel in a semver format.
@@ -41,36 +51,78 @@ const (
 	osPlatformKey = "os.platform"
 	// `os.version` specifies version of underlying operating system (e.g. 10.12.6).
 	osVersionKey = "os.version"
+	// `os.distro` is the distribution id (e.g. ubuntu, centos, rhel, debian, macos, windows).
+	osDistroKey = "os.distro"
+	// `os.distro_version` is the numeric release of the distribution (e.g. 22.04).
+	osDistroVersionKey = "os.distro_version"
+	// `os.distro_codename` is the release codename (e.g. jammy), when the platform has one;
+	// on Windows it is the product name (e.g. Windows 10 Pro).
+	osDistroCodenameKey = "os.distro_codename"
+	// `os.container` reports whether the agent is running inside a container.
+	osContainerKey = "os.container"
+	// `host.cloud` is the cloud provider the host is running on (e.g. aws, gcp, azure, none).
+	hostCloudKey = "host.cloud"
 )
 
-var (
-	boolexpVarStore    *constraintVarStore
-	boolexpMethodsRegs *boolexp.MethodsReg
-)
+// ConstraintFilter filters ast based on included constraints, pruning
+// datasources, inputs and outputs nodes whose constraints don't match.
+// store resolves the variables referenced by constraint expressions; pass
+// the same long-lived VarStore across reloads so its volatile fields
+// (agent.id, agent.tags, kernel/OS version) stay fresh.
+func ConstraintFilter(log *logger.Logger, ast *transpiler.AST, store VarStore) error {
+	regs, err := boolexpMethods(store)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range constraintFilterKeys {
+		if err := nodeConstraintFilter(log, ast, key, store, regs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NodeConstraintFilter prunes any node under key whose `constraints` or
+// `constraints_any` list doesn't match the current environment, so it can
+// be reused for datasources, inputs, outputs, or any other list node that
+// carries constraints. store is injected rather than read from a package
+// global so tests can supply fixtures and the agent runtime can push
+// updates (e.g. via store.Invalidate() on re-enrollment) without a restart.
+func NodeConstraintFilter(log *logger.Logger, ast *transpiler.AST, key string, store VarStore) error {
+	regs, err := boolexpMethods(store)
+	if err != nil {
+		return err
+	}
 
-// ConstraintFilter filters ast based on included constraints.
-func ConstraintFilter(log *logger.Logger, ast *transpiler.AST) error {
-	// get datasources
-	dsNode, found := transpiler.Lookup(ast, datasourcesKey)
+	return nodeConstraintFilter(log, ast, key, store, regs)
+}
+
+// nodeConstraintFilter is the shared implementation behind ConstraintFilter
+// and NodeConstraintFilter. regs is built once per call by the caller and
+// threaded through, rather than rebuilt for every constraint expression on
+// every node.
+func nodeConstraintFilter(log *logger.Logger, ast *transpiler.AST, key string, store VarStore, regs *boolexp.MethodsReg) error {
+	node, found := transpiler.Lookup(ast, key)
 	if !found {
 		return nil
 	}
 
-	dsListNode, ok := dsNode.Value().(*transpiler.List)
+	listNode, ok := node.Value().(*transpiler.List)
 	if !ok {
 		return nil
 	}
 
-	dsList, ok := dsListNode.Value().([]transpiler.Node)
+	list, ok := listNode.Value().([]transpiler.Node)
 	if !ok {
 		return nil
 	}
 
-	// for each datasource
 	i := 0
-	originalLen := len(dsList)
-	for i < len(dsList) {
-		constraintMatch, err := evaluateConstraints(log, dsList[i])
+	originalLen := len(list)
+	for i < len(list) {
+		constraintMatch, failing, err := evaluateConstraints(list[i], store, regs)
 		if err != nil {
 			return err
 		}
@@ -79,63 +131,115 @@ func ConstraintFilter(log *logger.Logger, ast *transpiler.AST) error {
 			i++
 			continue
 		}
-		dsList = append(dsList[:i], dsList[i+1:]...)
+
+		if failing != nil {
+			log.Infow("constraint not matching, pruning node",
+				"key", key,
+				"id", nodeIdentifier(list[i]),
+				"constraint_type", failing.key,
+				"expression", failing.expression,
+			)
+		}
+		list = append(list[:i], list[i+1:]...)
 	}
 
-	if len(dsList) == originalLen {
+	if len(list) == originalLen {
 		return nil
 	}
 
-	// Replace datasources with limited set
-	if err := transpiler.RemoveKey(datasourcesKey).Apply(ast); err != nil {
+	// Replace the list with the pruned set
+	if err := transpiler.RemoveKey(key).Apply(ast); err != nil {
 		return err
 	}
 
-	newList := transpiler.NewList(dsList)
-	return transpiler.Insert(ast, newList, datasourcesKey)
+	newList := transpiler.NewList(list)
+	return transpiler.Insert(ast, newList, key)
 }
 
-func evaluateConstraints(log *logger.Logger, datasourceNode transpiler.Node) (bool, error) {
-	constraintsNode, found := datasourceNode.Find(constraintsKey)
+// failingConstraint records which constraint caused a node to be pruned, for
+// the structured log line emitted by NodeConstraintFilter.
+type failingConstraint struct {
+	key        string // constraintsKey or constraintsAnyKey
+	expression string
+}
+
+func evaluateConstraints(node transpiler.Node, store VarStore, regs *boolexp.MethodsReg) (bool, *failingConstraint, error) {
+	allMatch, failing, err := evaluateConstraintList(node, constraintsKey, true, store, regs)
+	if err != nil || !allMatch {
+		return false, failing, err
+	}
+
+	anyMatch, failing, err := evaluateConstraintList(node, constraintsAnyKey, false, store, regs)
+	if err != nil || !anyMatch {
+		return false, failing, err
+	}
+
+	return true, nil, nil
+}
+
+// evaluateConstraintList evaluates the constraint list found under key on
+// node. When requireAll is true every expression must match (AND-all-of,
+// used for `constraints`); otherwise at least one must match (OR-any-of,
+// used for `constraints_any`). A node with no list under key is vacuously
+// fine in both modes, since it imposes no restriction.
+func evaluateConstraintList(node transpiler.Node, key string, requireAll bool, store VarStore, regs *boolexp.MethodsReg) (bool, *failingConstraint, error) {
+	constraintsNode, found := node.Find(key)
 	if !found {
-		return true, nil
+		return true, nil, nil
 	}
 
 	constraintsListNode, ok := constraintsNode.Value().(*transpiler.List)
 	if !ok {
-		return false, errors.New("constraints not a list", errors.TypeConfig)
+		return false, nil, errors.New(fmt.Sprintf("%s not a list", key), errors.TypeConfig)
 	}
 
 	constraintsList, ok := constraintsListNode.Value().([]transpiler.Node)
 	if !ok {
-		return false, errors.New("constraints not a list", errors.TypeConfig)
+		return false, nil, errors.New(fmt.Sprintf("%s not a list", key), errors.TypeConfig)
+	}
+
+	// An empty list (most likely `constraints_any: []`) imposes no
+	// restriction either way, same as the key being absent. Falling through
+	// the loop below would otherwise return requireAll's zero value (false
+	// for constraints_any) with no failingConstraint set, pruning the node
+	// with no log line to explain why.
+	if len(constraintsList) == 0 {
+		return true, nil, nil
 	}
 
+	var lastFailing *failingConstraint
 	for _, c := range constraintsList {
 		strval, ok := c.(*transpiler.StrVal)
 		if !ok {
-			return false, errors.New("constraints is not a string")
+			return false, nil, errors.New(fmt.Sprintf("%s is not a string", key))
 		}
 
-		constraint := strval.String()
-		if isOK, err := evaluateConstraint(constraint); !isOK || err != nil {
-			if err == nil {
-				// log only constraint not matching
-				log.Infof("constraint '%s' not matching for datasource '%s'", constraint, datasourceIdentifier(datasourceNode))
-			}
+		expression := strval.String()
+		isOK, err := evaluateConstraint(expression, store, regs)
+		if err != nil {
+			return false, nil, err
+		}
 
-			return false, err
+		if isOK && !requireAll {
+			return true, nil, nil
+		}
+
+		if !isOK {
+			lastFailing = &failingConstraint{key: key, expression: expression}
+			if requireAll {
+				return false, lastFailing, nil
+			}
 		}
 	}
 
-	return true, nil
+	return requireAll, lastFailing, nil
 }
 
-func datasourceIdentifier(datasourceNode transpiler.Node) string {
+func nodeIdentifier(node transpiler.Node) string {
 	namespace := "default"
 	output := "default"
 
-	if nsNode, found := datasourceNode.Find("namespace"); found {
+	if nsNode, found := node.Find("namespace"); found {
 		nsKey, ok := nsNode.(*transpiler.Key)
 		if ok {
 			if valNode, ok := nsKey.Value().(transpiler.Node); ok {
@@ -144,7 +248,7 @@ func datasourceIdentifier(datasourceNode transpiler.Node) string {
 		}
 	}
 
-	if outNode, found := datasourceNode.Find("use_output"); found {
+	if outNode, found := node.Find("use_output"); found {
 		nsKey, ok := outNode.(*transpiler.Key)
 		if ok {
 			if valNode, ok := nsKey.Value().(transpiler.Node); ok {
@@ -154,7 +258,7 @@ func datasourceIdentifier(datasourceNode transpiler.Node) string {
 	}
 
 	ID := "unknown"
-	if idNode, found := datasourceNode.Find("id"); found {
+	if idNode, found := node.Find("id"); found {
 		nsKey, ok := idNode.(*transpiler.Key)
 		if ok {
 			if valNode, ok := nsKey.Value().(transpiler.Node); ok {
@@ -166,40 +270,50 @@ func datasourceIdentifier(datasourceNode transpiler.Node) string {
 	return fmt.Sprintf("namespace:%s, output:%s, id:%s", namespace, output, ID)
 }
 
-func evaluateConstraint(constraint string) (bool, error) {
-	store, regs, err := boolexpMachinery()
-	if err != nil {
-		return false, err
-	}
-
+func evaluateConstraint(constraint string, store VarStore, regs *boolexp.MethodsReg) (bool, error) {
 	return boolexp.Eval(constraint, regs, store)
 }
 
-func boolexpMachinery() (*constraintVarStore, *boolexp.MethodsReg, error) {
-	if boolexpMethodsRegs != nil && boolexpVarStore != nil {
-		return boolexpVarStore, boolexpMethodsRegs, nil
-	}
-
+// boolexpMethods builds the registry of functions available to constraint
+// expressions. Most hold no host/agent state (that lives in VarStore) and
+// could be rebuilt unconditionally; has_tag is the exception, since
+// `has_tag('foo')` needs store access to resolve agent.tags itself rather
+// than requiring the constraint author to substitute it in by hand.
+func boolexpMethods(store VarStore) (*boolexp.MethodsReg, error) {
 	regs := boolexp.NewMethodsReg()
 	if err := regs.Register(validateVersionFuncName, regValidateVersion); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	store, err := newVarStore()
-	if err != nil {
-		return nil, nil, err
+	if err := regs.Register(validateSemverFuncName, regValidateSemver); err != nil {
+		return nil, err
 	}
 
-	if err := initVarStore(store); err != nil {
-		return nil, nil, err
+	if err := regs.Register(matchesFuncName, regMatches); err != nil {
+		return nil, err
 	}
 
-	boolexpMethodsRegs = regs
-	boolexpVarStore = store
+	if err := regs.Register(oneOfFuncName, regOneOf); err != nil {
+		return nil, err
+	}
+
+	if err := regs.Register(inFuncName, regIn); err != nil {
+		return nil, err
+	}
+
+	if err := regs.Register(hasTagFuncName, newHasTagFunc(store)); err != nil {
+		return nil, err
+	}
 
-	return boolexpVarStore, boolexpMethodsRegs, nil
+	return regs, nil
 }
 
+// regValidateVersion implements `validate_version`, which uses
+// Masterminds/semver's package-manager style `Validate`: a constraint like
+// `>= 0.6.1` will not match a prerelease such as `1.3.0-beta1` unless the
+// constraint itself carries a prerelease. Kept for backwards compatibility;
+// use `validate_semver` when prereleases need to participate in ordering
+// (e.g. gating beta/rc agent builds).
 func regValidateVersion(args []interface{}) (interface{}, error) {
 	if len(args) != 2 {
 		return false, errors.New("validate_version: invalid number of arguments, expecting 2")
@@ -228,47 +342,3 @@ func regValidateVersion(args []interface{}) (interface{}, error) {
 	isOK, _ := c.Validate(v)
 	return isOK, nil
 }
-
-type constraintVarStore struct {
-	vars map[string]interface{}
-}
-
-func (s *constraintVarStore) Lookup(v string) (interface{}, bool) {
-	val, ok := s.vars[v]
-	return val, ok
-}
-
-func newVarStore() (*constraintVarStore, error) {
-	return &constraintVarStore{
-		vars: make(map[string]interface{}),
-	}, nil
-}
-
-func initVarStore(store *constraintVarStore) error {
-	sysInfo, err := sysinfo.Host()
-	if err != nil {
-		return err
-	}
-
-	agentInfo, err := info.NewAgentInfo()
-	if err != nil {
-		return err
-	}
-
-	info := sysInfo.Info()
-
-	// 	Agent
-	store.vars[agentIDKey] = agentInfo.AgentID()
-	store.vars[agentVersionKey] = release.Version()
-
-	// Host
-	store.vars[hostArchKey] = info.Architecture
-
-	// Operating system
-	store.vars[osFamilyKey] = runtime.GOOS
-	store.vars[osKernelKey] = info.KernelVersion
-	store.vars[osPlatformKey] = info.OS.Family
-	store.vars[osVersionKey] = info.OS.Version
-
-	return nil
-}
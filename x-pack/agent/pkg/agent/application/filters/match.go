@@ -0,0 +1,159 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package filters
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/elastic/beats/v7/x-pack/agent/pkg/agent/errors"
+)
+
+const (
+	matchesFuncName = "matches"
+	oneOfFuncName   = "one_of"
+	inFuncName      = "in"
+	hasTagFuncName  = "has_tag"
+)
+
+// regexpCache avoids recompiling the same pattern on every constraint
+// evaluation; datasource lists are re-filtered on every policy reload.
+var regexpCache sync.Map // map[string]*regexp.Regexp
+
+func regMatches(args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return false, errors.New("matches: invalid number of arguments, expecting 2")
+	}
+
+	value, isString := args[0].(string)
+	if !isString {
+		return false, errors.New("matches: value should be a string")
+	}
+
+	pattern, isString := args[1].(string)
+	if !isString {
+		return false, errors.New("matches: pattern should be a string")
+	}
+
+	re, err := compileCached(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	return re.MatchString(value), nil
+}
+
+func compileCached(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := regexpCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("matches: pattern '%s' is invalid", pattern))
+	}
+
+	regexpCache.Store(pattern, re)
+	return re, nil
+}
+
+func regOneOf(args []interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return false, errors.New("one_of: invalid number of arguments, expecting at least 2")
+	}
+
+	value, isString := args[0].(string)
+	if !isString {
+		return false, errors.New("one_of: value should be a string")
+	}
+
+	for _, candidate := range args[1:] {
+		if candidateStr, ok := candidate.(string); ok && candidateStr == value {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func regIn(args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return false, errors.New("in: invalid number of arguments, expecting 2")
+	}
+
+	value, isString := args[0].(string)
+	if !isString {
+		return false, errors.New("in: value should be a string")
+	}
+
+	list, ok := toStringSlice(args[1])
+	if !ok {
+		return false, errors.New("in: second argument should be a list of strings")
+	}
+
+	return stringSliceContains(list, value), nil
+}
+
+// newHasTagFunc binds `has_tag` to store, so it can be called as the
+// single-argument `has_tag('foo')` rather than requiring the caller to
+// thread %{agent.tags} through by hand.
+func newHasTagFunc(store VarStore) func([]interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		return regHasTag(store, args)
+	}
+}
+
+func regHasTag(store VarStore, args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return false, errors.New("has_tag: invalid number of arguments, expecting 1")
+	}
+
+	tag, isString := args[0].(string)
+	if !isString {
+		return false, errors.New("has_tag: tag should be a string")
+	}
+
+	tagsVal, found := store.Lookup(agentTagsKey)
+	if !found {
+		return false, nil
+	}
+
+	tags, ok := toStringSlice(tagsVal)
+	if !ok {
+		return false, nil
+	}
+
+	return stringSliceContains(tags, tag), nil
+}
+
+func toStringSlice(v interface{}) ([]string, bool) {
+	switch vv := v.(type) {
+	case []string:
+		return vv, true
+	case []interface{}:
+		out := make([]string, 0, len(vv))
+		for _, item := range vv {
+			str, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, str)
+		}
+		return out, true
+	default:
+		return nil, false
+	}
+}
+
+func stringSliceContains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,132 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package filters
+
+import (
+	"testing"
+
+	"github.com/elastic/beats/v7/x-pack/agent/pkg/boolexp"
+)
+
+// fakeVarStore is a fixture VarStore for tests, so constraint evaluation
+// doesn't depend on the real host/agent.
+type fakeVarStore struct {
+	vars map[string]interface{}
+}
+
+func (s *fakeVarStore) Lookup(key string) (interface{}, bool) {
+	v, ok := s.vars[key]
+	return v, ok
+}
+
+func (s *fakeVarStore) Invalidate() {}
+
+func evalWithStore(t *testing.T, expression string, store VarStore) bool {
+	t.Helper()
+
+	regs, err := boolexpMethods(store)
+	if err != nil {
+		t.Fatalf("boolexpMethods: %v", err)
+	}
+
+	isOK, err := boolexp.Eval(expression, regs, store)
+	if err != nil {
+		t.Fatalf("boolexp.Eval(%q): %v", expression, err)
+	}
+
+	return isOK
+}
+
+func TestRegMatchesThroughBoolexp(t *testing.T) {
+	store := &fakeVarStore{vars: map[string]interface{}{
+		hostNameKey: "web-42",
+	}}
+
+	if !evalWithStore(t, `matches(%{host.name}, '^web-\\d+$')`, store) {
+		t.Error("expected host.name 'web-42' to match '^web-\\d+$'")
+	}
+
+	if evalWithStore(t, `matches(%{host.name}, '^db-\\d+$')`, store) {
+		t.Error("expected host.name 'web-42' not to match '^db-\\d+$'")
+	}
+}
+
+func TestRegOneOfThroughBoolexp(t *testing.T) {
+	store := &fakeVarStore{vars: map[string]interface{}{
+		osPlatformKey: "ubuntu",
+	}}
+
+	if !evalWithStore(t, `one_of(%{os.platform}, 'ubuntu', 'debian')`, store) {
+		t.Error("expected os.platform 'ubuntu' to be one_of ubuntu/debian")
+	}
+
+	if evalWithStore(t, `one_of(%{os.platform}, 'centos', 'rhel')`, store) {
+		t.Error("expected os.platform 'ubuntu' not to be one_of centos/rhel")
+	}
+}
+
+func TestRegInThroughBoolexp(t *testing.T) {
+	store := &fakeVarStore{vars: map[string]interface{}{
+		osPlatformKey: "ubuntu",
+	}}
+
+	if !evalWithStore(t, `in(%{os.platform}, ['ubuntu', 'debian'])`, store) {
+		t.Error("expected os.platform 'ubuntu' to be in [ubuntu, debian]")
+	}
+
+	if evalWithStore(t, `in(%{os.platform}, ['centos', 'rhel'])`, store) {
+		t.Error("expected os.platform 'ubuntu' not to be in [centos, rhel]")
+	}
+}
+
+func TestRegHasTagThroughBoolexp(t *testing.T) {
+	store := &fakeVarStore{vars: map[string]interface{}{
+		agentTagsKey: []string{"canary", "eu-west-1"},
+	}}
+
+	if !evalWithStore(t, `has_tag('canary')`, store) {
+		t.Error("expected has_tag('canary') to match an agent tagged canary")
+	}
+
+	if evalWithStore(t, `has_tag('production')`, store) {
+		t.Error("expected has_tag('production') not to match an agent without that tag")
+	}
+}
+
+func TestRegHasTagNoTagsVar(t *testing.T) {
+	store := &fakeVarStore{vars: map[string]interface{}{}}
+
+	if evalWithStore(t, `has_tag('canary')`, store) {
+		t.Error("expected has_tag to be false when agent.tags is unset")
+	}
+}
+
+func TestRegHasTagDirect(t *testing.T) {
+	store := &fakeVarStore{vars: map[string]interface{}{
+		agentTagsKey: []string{"canary"},
+	}}
+
+	got, err := newHasTagFunc(store)([]interface{}{"canary"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != true {
+		t.Errorf("has_tag('canary') = %v, want true", got)
+	}
+
+	if _, err := newHasTagFunc(store)([]interface{}{"canary", "extra"}); err == nil {
+		t.Error("expected error for wrong argument count")
+	}
+}
+
+func TestRegInInvalidArgs(t *testing.T) {
+	if _, err := regIn([]interface{}{"ubuntu"}); err == nil {
+		t.Error("expected error for wrong argument count")
+	}
+
+	if _, err := regIn([]interface{}{"ubuntu", "not-a-list"}); err == nil {
+		t.Error("expected error when second argument isn't a list")
+	}
+}
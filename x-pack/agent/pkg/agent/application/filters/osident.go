@@ -0,0 +1,21 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package filters
+
+// osIdentity carries the distro-level identity of the host, as opposed to
+// the coarser os.family (runtime.GOOS) and the os.platform/os.version
+// reported by go-sysinfo.
+// It is populated by the platform-specific detectOSIdentity implementation.
+type osIdentity struct {
+	// Distro is the distribution id (e.g. ubuntu, centos, rhel, debian, macos, windows).
+	Distro string
+	// DistroVersion is the numeric release of the distribution (e.g. 22.04).
+	DistroVersion string
+	// DistroCodename is the release codename (e.g. jammy), when the platform has one.
+	// On Windows it holds the registry ProductName (e.g. Windows 10 Pro).
+	DistroCodename string
+	// Container reports whether the agent is running inside a container.
+	Container bool
+}
@@ -0,0 +1,32 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build darwin
+
+package filters
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// detectOSIdentity shells out to sw_vers, the same tool macOS itself uses to
+// report its product version. macOS has no distro/codename split exposed to
+// constraints, so Distro is fixed and DistroCodename is left empty.
+func detectOSIdentity() osIdentity {
+	return osIdentity{
+		Distro:        "macos",
+		DistroVersion: swVers("-productVersion"),
+		Container:     false,
+	}
+}
+
+func swVers(flag string) string {
+	out, err := exec.Command("sw_vers", flag).Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(out))
+}
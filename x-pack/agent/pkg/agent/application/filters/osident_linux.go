@@ -0,0 +1,81 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build linux
+
+package filters
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const osReleasePath = "/etc/os-release"
+
+// detectOSIdentity reads /etc/os-release for the distribution id, version
+// and codename, and inspects cgroup/well-known files for container detection.
+func detectOSIdentity() osIdentity {
+	ident := osIdentity{
+		Container: isRunningInContainer(),
+	}
+
+	f, err := os.Open(osReleasePath)
+	if err != nil {
+		return ident
+	}
+	defer f.Close()
+
+	fields := parseOSRelease(f)
+	ident.Distro = fields["ID"]
+	ident.DistroVersion = fields["VERSION_ID"]
+	ident.DistroCodename = fields["VERSION_CODENAME"]
+
+	return ident
+}
+
+func parseOSRelease(f *os.File) map[string]string {
+	fields := make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		fields[parts[0]] = strings.Trim(parts[1], `"`)
+	}
+
+	return fields
+}
+
+// isRunningInContainer uses the same heuristics as most container-aware
+// tooling: a dedicated marker file dropped by the Docker runtime, or
+// container/kubepods references in the init cgroup.
+func isRunningInContainer() bool {
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return true
+	}
+
+	data, err := ioutil.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+
+	content := string(data)
+	for _, marker := range []string{"docker", "kubepods", "containerd", "lxc"} {
+		if strings.Contains(content, marker) {
+			return true
+		}
+	}
+
+	return false
+}
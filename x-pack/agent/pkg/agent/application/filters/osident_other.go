@@ -0,0 +1,12 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build !linux,!darwin,!windows
+
+package filters
+
+// detectOSIdentity is a no-op on platforms without a dedicated implementation.
+func detectOSIdentity() osIdentity {
+	return osIdentity{}
+}
@@ -0,0 +1,38 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// +build windows
+
+package filters
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+const currentVersionKey = `SOFTWARE\Microsoft\Windows NT\CurrentVersion`
+
+// detectOSIdentity reads the CurrentVersion registry key, the same source
+// Windows itself uses for winver. Windows has no container runtime detection
+// here; Container is always false.
+func detectOSIdentity() osIdentity {
+	ident := osIdentity{Distro: "windows"}
+
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, currentVersionKey, registry.QUERY_VALUE)
+	if err != nil {
+		return ident
+	}
+	defer k.Close()
+
+	if displayVersion, _, err := k.GetStringValue("DisplayVersion"); err == nil {
+		ident.DistroVersion = displayVersion
+	} else if releaseID, _, err := k.GetStringValue("ReleaseId"); err == nil {
+		ident.DistroVersion = releaseID
+	}
+
+	if productName, _, err := k.GetStringValue("ProductName"); err == nil {
+		ident.DistroCodename = productName
+	}
+
+	return ident
+}
@@ -0,0 +1,146 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package filters
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver"
+
+	"github.com/elastic/beats/v7/x-pack/agent/pkg/agent/errors"
+)
+
+const validateSemverFuncName = "validate_semver"
+
+// semverClauseRe splits a single clause of a semver constraint into its
+// optional operator and the version it is compared against, e.g.
+// ">= 7.10.0-beta1" -> (">=", "7.10.0-beta1").
+var semverClauseRe = regexp.MustCompile(`^\s*(>=|<=|~>|!=|>|<|=)?\s*(.+?)\s*$`)
+
+// semverClause is a single `<op> <version>` comparison, e.g. `>= 7.10.0-beta1`.
+type semverClause struct {
+	op      string
+	version *semver.Version
+}
+
+// semverConstraint is a set of OR'd groups of AND'd clauses, mirroring the
+// `,` (and) / `||` (or) composition supported by validate_version, but
+// evaluated with strict SemVer 2.0 precedence instead of Validate's
+// prerelease-excluding behavior.
+type semverConstraint struct {
+	orGroups [][]semverClause
+}
+
+func parseSemverConstraint(constraint string) (*semverConstraint, error) {
+	orParts := strings.Split(constraint, "||")
+	orGroups := make([][]semverClause, 0, len(orParts))
+
+	for _, orPart := range orParts {
+		andParts := strings.Split(orPart, ",")
+		clauses := make([]semverClause, 0, len(andParts))
+
+		for _, andPart := range andParts {
+			clause, err := parseSemverClause(andPart)
+			if err != nil {
+				return nil, err
+			}
+			clauses = append(clauses, clause)
+		}
+
+		orGroups = append(orGroups, clauses)
+	}
+
+	return &semverConstraint{orGroups: orGroups}, nil
+}
+
+func parseSemverClause(raw string) (semverClause, error) {
+	matches := semverClauseRe.FindStringSubmatch(raw)
+	if matches == nil {
+		return semverClause{}, errors.New(fmt.Sprintf("semver clause '%s' is invalid", raw))
+	}
+
+	op := matches[1]
+	if op == "" {
+		op = "="
+	}
+
+	v, err := semver.NewVersion(matches[2])
+	if err != nil {
+		return semverClause{}, errors.New(fmt.Sprintf("version '%s' is invalid", matches[2]))
+	}
+
+	return semverClause{op: op, version: v}, nil
+}
+
+// check evaluates version against the constraint, comparing prerelease
+// identifiers per SemVer 2.0 §11 rather than gating them out like
+// validate_version does.
+func (c *semverConstraint) check(version *semver.Version) bool {
+	for _, clauses := range c.orGroups {
+		allMatch := true
+		for _, clause := range clauses {
+			if !clause.check(version) {
+				allMatch = false
+				break
+			}
+		}
+		if allMatch {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c semverClause) check(version *semver.Version) bool {
+	cmp := version.Compare(c.version)
+
+	switch c.op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "!=":
+		return cmp != 0
+	case "~>":
+		return cmp >= 0 && version.Major() == c.version.Major() && version.Minor() == c.version.Minor()
+	default: // "="
+		return cmp == 0
+	}
+}
+
+func regValidateSemver(args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return false, errors.New("validate_semver: invalid number of arguments, expecting 2")
+	}
+
+	version, isString := args[0].(string)
+	if !isString {
+		return false, errors.New("version should be a string")
+	}
+
+	constraint, isString := args[1].(string)
+	if !isString {
+		return false, errors.New("version constraint should be a string")
+	}
+
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("version '%s' is invalid", version))
+	}
+
+	c, err := parseSemverConstraint(constraint)
+	if err != nil {
+		return false, err
+	}
+
+	return c.check(v), nil
+}
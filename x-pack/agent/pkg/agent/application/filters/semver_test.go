@@ -0,0 +1,110 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package filters
+
+import "testing"
+
+func TestRegValidateSemver(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    string
+		constraint string
+		want       bool
+	}{
+		{
+			name:       "prerelease satisfies >= unlike validate_version",
+			version:    "1.3.0-beta1",
+			constraint: ">= 0.6.1",
+			want:       true,
+		},
+		{
+			name:       "prerelease ordered before its own release per SemVer 2.0 11",
+			version:    "1.0.0-alpha",
+			constraint: "< 1.0.0",
+			want:       true,
+		},
+		{
+			name:       "equal versions match =",
+			version:    "7.10.0",
+			constraint: "= 7.10.0",
+			want:       true,
+		},
+		{
+			name:       "bare version implies =",
+			version:    "7.10.0",
+			constraint: "7.10.1",
+			want:       false,
+		},
+		{
+			name:       "~> bounds the minor",
+			version:    "1.2.9",
+			constraint: "~> 1.2.3",
+			want:       true,
+		},
+		{
+			name:       "~> excludes the next minor",
+			version:    "1.3.0",
+			constraint: "~> 1.2.3",
+			want:       false,
+		},
+		{
+			name:       "comma composes as AND",
+			version:    "1.5.0",
+			constraint: ">= 1.0.0, < 2.0.0",
+			want:       true,
+		},
+		{
+			name:       "AND fails if any clause fails",
+			version:    "2.0.0",
+			constraint: ">= 1.0.0, < 2.0.0",
+			want:       false,
+		},
+		{
+			name:       "|| composes as OR",
+			version:    "2.0.0",
+			constraint: "1.0.0 || 2.0.0",
+			want:       true,
+		},
+		{
+			name:       "OR fails if no group matches",
+			version:    "3.0.0",
+			constraint: "1.0.0 || 2.0.0",
+			want:       false,
+		},
+		{
+			name:       "beta satisfies constraint gated by a matching beta floor",
+			version:    "7.10.0-beta1",
+			constraint: ">= 7.10.0-beta1",
+			want:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := regValidateSemver([]interface{}{tt.version, tt.constraint})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("validate_semver(%q, %q) = %v, want %v", tt.version, tt.constraint, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegValidateSemverInvalidArgs(t *testing.T) {
+	if _, err := regValidateSemver([]interface{}{"1.0.0"}); err == nil {
+		t.Error("expected error for wrong argument count")
+	}
+
+	if _, err := regValidateSemver([]interface{}{"not-a-version", ">= 1.0.0"}); err == nil {
+		t.Error("expected error for invalid version")
+	}
+
+	if _, err := regValidateSemver([]interface{}{"1.0.0", "not a constraint !!"}); err == nil {
+		t.Error("expected error for invalid constraint")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package filters
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/x-pack/agent/pkg/agent/application/info"
+	"github.com/elastic/beats/v7/x-pack/agent/pkg/release"
+	"github.com/elastic/go-sysinfo"
+)
+
+// volatileTTL bounds how stale agent.id, agent.tags and kernel/OS version
+// variables are allowed to get before a Lookup re-reads them. It is short
+// enough that a kernel upgrade, hostname change or fleet re-enrollment is
+// picked up by the next policy reload without restarting the agent.
+const volatileTTL = 30 * time.Second
+
+// VarStore resolves variables referenced by constraint expressions.
+// Implementations may read some of them once (values that never change for
+// the life of the process) and others on every Lookup (values that can
+// change while the agent is running, such as agent.id after re-enrollment).
+type VarStore interface {
+	Lookup(key string) (interface{}, bool)
+	// Invalidate forces the next Lookup to re-read volatile variables,
+	// letting the agent runtime push updates (e.g. info.AgentInfo rotating)
+	// instead of waiting out the TTL.
+	Invalidate()
+}
+
+// hostVarStore is the default VarStore, backed by go-sysinfo and the local
+// agent's info.AgentInfo.
+type hostVarStore struct {
+	static map[string]interface{}
+
+	mu       sync.Mutex
+	expires  time.Time
+	volatile map[string]interface{}
+}
+
+// NewVarStore builds the default VarStore for the running host and agent.
+func NewVarStore() (VarStore, error) {
+	static, err := collectStaticVars()
+	if err != nil {
+		return nil, err
+	}
+
+	return &hostVarStore{static: static}, nil
+}
+
+func (s *hostVarStore) Lookup(key string) (interface{}, bool) {
+	if v, ok := s.static[key]; ok {
+		return v, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Now().After(s.expires) {
+		vars, err := collectVolatileVars()
+		if err == nil {
+			s.volatile = vars
+			s.expires = time.Now().Add(volatileTTL)
+		}
+	}
+
+	v, ok := s.volatile[key]
+	return v, ok
+}
+
+func (s *hostVarStore) Invalidate() {
+	s.mu.Lock()
+	s.expires = time.Time{}
+	s.mu.Unlock()
+}
+
+// collectStaticVars reads the variables that cannot meaningfully change
+// between the start of the process and the next constraint evaluation.
+// detectOSIdentity is called exactly once for the life of the VarStore
+// here; a distro's id, codename and version are all read from the same
+// /etc/os-release (or platform equivalent) snapshot, so they can't end up
+// observing inconsistent states across separate reads.
+// os.distro_version is not re-read on a volatile refresh: a point release
+// applied while the agent runs shows up in os.version, but os.distro_version
+// keeps the value read when the VarStore was built.
+func collectStaticVars() (map[string]interface{}, error) {
+	sysInfo, err := sysinfo.Host()
+	if err != nil {
+		return nil, err
+	}
+	hostInfo := sysInfo.Info()
+
+	osIdent := detectOSIdentity()
+
+	return map[string]interface{}{
+		hostArchKey:         hostInfo.Architecture,
+		hostNameKey:         hostInfo.Hostname,
+		osFamilyKey:         runtime.GOOS,
+		osPlatformKey:       hostInfo.OS.Family,
+		osDistroKey:         osIdent.Distro,
+		osDistroVersionKey:  osIdent.DistroVersion,
+		osDistroCodenameKey: osIdent.DistroCodename,
+		osContainerKey:      osIdent.Container,
+		hostCloudKey:        detectCloud(),
+	}, nil
+}
+
+// collectVolatileVars re-reads the variables that can legitimately change
+// while the agent process is running without a restart: a kernel upgrade,
+// an OS point release, fleet re-enrollment (new agent.id), or newly
+// attached tags.
+func collectVolatileVars() (map[string]interface{}, error) {
+	sysInfo, err := sysinfo.Host()
+	if err != nil {
+		return nil, err
+	}
+	hostInfo := sysInfo.Info()
+
+	agentInfo, err := info.NewAgentInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		agentIDKey:      agentInfo.AgentID(),
+		agentVersionKey: release.Version(),
+		agentTagsKey:    agentTags(agentInfo),
+		osKernelKey:     hostInfo.KernelVersion,
+		osVersionKey:    hostInfo.OS.Version,
+	}, nil
+}
+
+// tagger is the subset of info.AgentInfo that exposes fleet-assigned tags.
+// agent.tags/has_tag only need this one method, so we depend on it directly
+// instead of on the full info.AgentInfo type; if a given build of
+// info.AgentInfo doesn't implement it yet, agentTags degrades to an empty
+// list rather than failing to compile.
+type tagger interface {
+	Tags() []string
+}
+
+func agentTags(agentInfo interface{}) []string {
+	t, ok := agentInfo.(tagger)
+	if !ok {
+		return nil
+	}
+	return t.Tags()
+}